@@ -0,0 +1,299 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/archive"
+)
+
+// exportCheckpointArchive packages a checkpoint directory into a single,
+// portable .tar.gz with the following layout, self-describing so it can
+// be consumed on another host:
+//
+//	spec.dump          OCI runtime spec copied from the container's bundle
+//	config.dump        docker inspect JSON for the container
+//	checkpoint/         CRIU images, container.json and checkpoint-stats.json
+//	rootfs-diff.tar     tar of files added/changed in the container's r/w layer
+//	volumes/<name>.tar  one tarball per named volume mounted into the container
+func exportCheckpointArchive(info *ContainerInfo, checkpointDir, exportPath string) error {
+	if info.Runtime != "docker" {
+		return fmt.Errorf("-export only supports the docker runtime backend, container was inspected via %q", info.Runtime)
+	}
+
+	out, err := os.Create(exportPath)
+	if err != nil {
+		return fmt.Errorf("failed to create export archive: %w", err)
+	}
+	defer out.Close()
+
+	gz := gzip.NewWriter(out)
+	defer gz.Close()
+
+	tw := tar.NewWriter(gz)
+	defer tw.Close()
+
+	ctx := context.Background()
+	cli, err := client.NewClientWithOpts(client.FromEnv)
+	if err != nil {
+		return fmt.Errorf("failed to create docker client: %w", err)
+	}
+
+	containerJSON, err := cli.ContainerInspect(ctx, info.ID)
+	if err != nil {
+		return fmt.Errorf("failed to inspect container: %w", err)
+	}
+
+	configDump, err := json.MarshalIndent(containerJSON, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal config.dump: %w", err)
+	}
+	if err := addBytesToTar(tw, "config.dump", configDump); err != nil {
+		return err
+	}
+
+	specPath := filepath.Join(info.BundlePath, "config.json")
+	if specData, err := os.ReadFile(specPath); err == nil {
+		if err := addBytesToTar(tw, "spec.dump", specData); err != nil {
+			return err
+		}
+	} else {
+		fmt.Printf("warning: could not read runtime spec from %s: %v\n", specPath, err)
+	}
+
+	if err := addDirToTar(tw, checkpointDir, "checkpoint"); err != nil {
+		return fmt.Errorf("failed to add checkpoint dir to archive: %w", err)
+	}
+
+	if err := addRootFSDiff(tw, ctx, cli, info); err != nil {
+		return fmt.Errorf("failed to add rootfs diff to archive: %w", err)
+	}
+
+	if err := addVolumes(tw, containerJSON.Mounts); err != nil {
+		return fmt.Errorf("failed to add volumes to archive: %w", err)
+	}
+
+	fmt.Printf("Exported checkpoint archive to %s\n", exportPath)
+	return nil
+}
+
+// addRootFSDiff tars the files added or changed in the container's
+// read-write layer, as reported by the Docker diff API, into a
+// rootfs-diff.tar entry of the outer archive.
+func addRootFSDiff(tw *tar.Writer, ctx context.Context, cli *client.Client, info *ContainerInfo) error {
+	changes, err := cli.ContainerDiff(ctx, info.ID)
+	if err != nil {
+		return fmt.Errorf("failed to diff container: %w", err)
+	}
+
+	var diffBuf bytes.Buffer
+	diffTw := tar.NewWriter(&diffBuf)
+	for _, change := range changes {
+		if change.Kind == archive.ChangeDelete {
+			continue
+		}
+
+		hostPath := filepath.Join(info.RootFS, change.Path)
+		if err := addFileToTar(diffTw, hostPath, change.Path); err != nil {
+			fmt.Printf("warning: skipping %s in rootfs diff: %v\n", change.Path, err)
+		}
+	}
+	if err := diffTw.Close(); err != nil {
+		return err
+	}
+
+	return addBytesToTar(tw, "rootfs-diff.tar", diffBuf.Bytes())
+}
+
+// addVolumes tars each named volume mounted into the container into its
+// own archive under volumes/.
+func addVolumes(tw *tar.Writer, mounts []types.MountPoint) error {
+	for _, mount := range mounts {
+		if mount.Type != "volume" || mount.Name == "" {
+			continue
+		}
+
+		var volBuf bytes.Buffer
+		volTw := tar.NewWriter(&volBuf)
+		if err := addDirToTar(volTw, mount.Source, ""); err != nil {
+			volTw.Close()
+			fmt.Printf("warning: skipping volume %s: %v\n", mount.Name, err)
+			continue
+		}
+		if err := volTw.Close(); err != nil {
+			return err
+		}
+
+		if err := addBytesToTar(tw, filepath.Join("volumes", mount.Name+".tar"), volBuf.Bytes()); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// addBytesToTar writes a single in-memory file entry to tw.
+func addBytesToTar(tw *tar.Writer, name string, data []byte) error {
+	header := &tar.Header{
+		Name: name,
+		Mode: 0644,
+		Size: int64(len(data)),
+	}
+	if err := tw.WriteHeader(header); err != nil {
+		return fmt.Errorf("failed to write archive header for %s: %w", name, err)
+	}
+	_, err := tw.Write(data)
+	return err
+}
+
+// addFileToTar copies a single file on disk into tw under name.
+func addFileToTar(tw *tar.Writer, path, name string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	header, err := tar.FileInfoHeader(info, "")
+	if err != nil {
+		return err
+	}
+	header.Name = name
+
+	if err := tw.WriteHeader(header); err != nil {
+		return err
+	}
+	_, err = io.Copy(tw, file)
+	return err
+}
+
+// addDirToTar recursively copies dir into tw, prefixing entry names with
+// prefix (pass "" to store paths relative to dir itself).
+func addDirToTar(tw *tar.Writer, dir, prefix string) error {
+	return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		name := filepath.Join(prefix, rel)
+
+		if info.IsDir() {
+			return nil
+		}
+
+		return addFileToTar(tw, path, name)
+	})
+}
+
+// importCheckpointArchive extracts a .tar.gz produced by
+// exportCheckpointArchive into baseDir/containerName/checkpointName so it
+// can be consumed by -restore. Entries under checkpoint/ are written
+// directly into that directory (the prefix is dropped); every other entry
+// keeps its archive path relative to it.
+func importCheckpointArchive(archivePath, baseDir, containerName, checkpointName string) error {
+	checkpointDir := filepath.Join(baseDir, containerName, checkpointName)
+	if err := os.MkdirAll(checkpointDir, 0755); err != nil {
+		return fmt.Errorf("failed to create checkpoint directory: %w", err)
+	}
+
+	in, err := os.Open(archivePath)
+	if err != nil {
+		return fmt.Errorf("failed to open import archive: %w", err)
+	}
+	defer in.Close()
+
+	gz, err := gzip.NewReader(in)
+	if err != nil {
+		return fmt.Errorf("failed to read import archive: %w", err)
+	}
+	defer gz.Close()
+
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read archive entry: %w", err)
+		}
+
+		name := header.Name
+		if rel, ok := stripPrefix(name, "checkpoint/"); ok {
+			name = rel
+		}
+
+		destPath := filepath.Join(checkpointDir, name)
+		if !isPathContained(checkpointDir, destPath) {
+			return fmt.Errorf("archive entry %q escapes checkpoint directory", header.Name)
+		}
+
+		if header.FileInfo().IsDir() {
+			if err := os.MkdirAll(destPath, 0755); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err := os.MkdirAll(filepath.Dir(destPath), 0755); err != nil {
+			return err
+		}
+
+		destFile, err := os.Create(destPath)
+		if err != nil {
+			return fmt.Errorf("failed to write %s: %w", destPath, err)
+		}
+		if _, err := io.Copy(destFile, tr); err != nil {
+			destFile.Close()
+			return fmt.Errorf("failed to write %s: %w", destPath, err)
+		}
+		destFile.Close()
+	}
+
+	fmt.Printf("Imported checkpoint archive into %s\n", checkpointDir)
+	return nil
+}
+
+func stripPrefix(name, prefix string) (string, bool) {
+	if len(name) > len(prefix) && name[:len(prefix)] == prefix {
+		return name[len(prefix):], true
+	}
+	return name, false
+}
+
+// isPathContained reports whether destPath (after archive entries have
+// been joined onto checkpointDir) still resolves inside checkpointDir,
+// guarding against tar entries using ".." or absolute paths to escape it
+// (tar-slip).
+func isPathContained(checkpointDir, destPath string) bool {
+	cleanDir := filepath.Clean(checkpointDir)
+	cleanDest := filepath.Clean(destPath)
+
+	if cleanDest == cleanDir {
+		return true
+	}
+
+	return strings.HasPrefix(cleanDest, cleanDir+string(os.PathSeparator))
+}
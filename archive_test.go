@@ -0,0 +1,110 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestIsPathContained(t *testing.T) {
+	checkpointDir := filepath.FromSlash("/tmp/docker-checkpoints/app/checkpoint1")
+
+	tests := []struct {
+		name     string
+		destPath string
+		want     bool
+	}{
+		{"same as checkpoint dir", checkpointDir, true},
+		{"file inside checkpoint dir", filepath.Join(checkpointDir, "container.json"), true},
+		{"nested dir inside checkpoint dir", filepath.Join(checkpointDir, "volumes", "data.tar"), true},
+		{"dot-dot escape to parent", filepath.Join(checkpointDir, "..", "evil"), false},
+		{"dot-dot escape further up", filepath.Join(checkpointDir, "..", "..", "etc", "passwd"), false},
+		{"sibling directory with shared prefix", checkpointDir + "-evil", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isPathContained(checkpointDir, tt.destPath); got != tt.want {
+				t.Errorf("isPathContained(%q, %q) = %v, want %v", checkpointDir, tt.destPath, got, tt.want)
+			}
+		})
+	}
+}
+
+// writeTarGz builds a .tar.gz at path containing the given entries, using
+// raw archive/tar so the test can construct both well-formed and
+// path-escaping archives without going through exportCheckpointArchive
+// (which requires a Docker daemon).
+func writeTarGz(t *testing.T, path string, entries map[string]string) {
+	t.Helper()
+
+	out, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("failed to create %s: %v", path, err)
+	}
+	defer out.Close()
+
+	gz := gzip.NewWriter(out)
+	defer gz.Close()
+
+	tw := tar.NewWriter(gz)
+	defer tw.Close()
+
+	for name, content := range entries {
+		header := &tar.Header{Name: name, Mode: 0644, Size: int64(len(content))}
+		if err := tw.WriteHeader(header); err != nil {
+			t.Fatalf("failed to write header for %s: %v", name, err)
+		}
+		if _, err := tw.Write([]byte(content)); err != nil {
+			t.Fatalf("failed to write content for %s: %v", name, err)
+		}
+	}
+}
+
+func TestImportCheckpointArchiveRoundTrip(t *testing.T) {
+	baseDir := t.TempDir()
+	archivePath := filepath.Join(t.TempDir(), "checkpoint.tar.gz")
+
+	writeTarGz(t, archivePath, map[string]string{
+		"checkpoint/container.json": `{"id":"abc123"}`,
+		"rootfs-diff.tar":           "fake-diff",
+	})
+
+	if err := importCheckpointArchive(archivePath, baseDir, "app", "checkpoint1"); err != nil {
+		t.Fatalf("importCheckpointArchive failed: %v", err)
+	}
+
+	checkpointDir := filepath.Join(baseDir, "app", "checkpoint1")
+
+	data, err := os.ReadFile(filepath.Join(checkpointDir, "container.json"))
+	if err != nil {
+		t.Fatalf("failed to read imported container.json: %v", err)
+	}
+	if string(data) != `{"id":"abc123"}` {
+		t.Errorf("container.json content = %q, want %q", data, `{"id":"abc123"}`)
+	}
+
+	if _, err := os.Stat(filepath.Join(checkpointDir, "rootfs-diff.tar")); err != nil {
+		t.Errorf("expected rootfs-diff.tar to be imported: %v", err)
+	}
+}
+
+func TestImportCheckpointArchiveRejectsPathEscape(t *testing.T) {
+	baseDir := t.TempDir()
+	archivePath := filepath.Join(t.TempDir(), "evil.tar.gz")
+
+	writeTarGz(t, archivePath, map[string]string{
+		"checkpoint/../../evil.json": `{"pwned":true}`,
+	})
+
+	err := importCheckpointArchive(archivePath, baseDir, "app", "checkpoint1")
+	if err == nil {
+		t.Fatal("expected importCheckpointArchive to reject a path-escaping entry, got nil error")
+	}
+
+	if _, statErr := os.Stat(filepath.Join(baseDir, "evil.json")); statErr == nil {
+		t.Error("path-escaping entry was written outside the checkpoint directory")
+	}
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/containerd/containerd"
+	"github.com/containerd/containerd/namespaces"
+	"github.com/docker/docker/client"
+)
+
+// ContainerBackend resolves the runtime details doCRIUCheckpoint needs
+// (pid, rootfs, bundle, cgroup path, namespaces) from whichever container
+// runtime is actually managing the container, so the CRIU invocation
+// logic stays runtime-agnostic.
+type ContainerBackend interface {
+	// Inspect returns the ContainerInfo for a running container.
+	Inspect(ctx context.Context, containerName string) (*ContainerInfo, error)
+}
+
+const (
+	dockerSocket     = "/var/run/docker.sock"
+	containerdSocket = "/run/containerd/containerd.sock"
+	crioSocket       = "/var/run/crio/crio.sock"
+
+	containerdNamespace = "k8s.io"
+)
+
+// selectBackend returns the ContainerBackend named by runtimeFlag
+// ("docker", "containerd" or "crio"), or auto-detects one by probing
+// each runtime's well-known socket when runtimeFlag is empty.
+func selectBackend(runtimeFlag string) (ContainerBackend, error) {
+	switch runtimeFlag {
+	case "docker":
+		return &dockerBackend{}, nil
+	case "containerd":
+		return &containerdBackend{}, nil
+	case "crio":
+		return &crioBackend{}, nil
+	case "":
+		return autoDetectBackend()
+	default:
+		return nil, fmt.Errorf("unknown -runtime %q (want docker, containerd or crio)", runtimeFlag)
+	}
+}
+
+// autoDetectBackend probes each runtime's well-known socket path and
+// returns the first one found, preferring Docker for backwards
+// compatibility with existing deployments of this tool.
+func autoDetectBackend() (ContainerBackend, error) {
+	if _, err := os.Stat(dockerSocket); err == nil {
+		return &dockerBackend{}, nil
+	}
+	if _, err := os.Stat(containerdSocket); err == nil {
+		return &containerdBackend{}, nil
+	}
+	if _, err := os.Stat(crioSocket); err == nil {
+		return &crioBackend{}, nil
+	}
+
+	return nil, fmt.Errorf("could not auto-detect a container runtime (looked for %s, %s, %s)",
+		dockerSocket, containerdSocket, crioSocket)
+}
+
+// dockerBackend talks to a Docker daemon over its Unix socket.
+type dockerBackend struct{}
+
+func (b *dockerBackend) Inspect(ctx context.Context, containerName string) (*ContainerInfo, error) {
+	cli, err := client.NewClientWithOpts(client.FromEnv)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create docker client: %w", err)
+	}
+
+	containerJSON, err := cli.ContainerInspect(ctx, containerName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to inspect container: %w", err)
+	}
+
+	if !containerJSON.State.Running {
+		return nil, fmt.Errorf("container %s is not running", containerName)
+	}
+
+	runtime := containerJSON.HostConfig.Runtime
+	if runtime == "" {
+		runtime = "runc"
+	}
+
+	info := &ContainerInfo{
+		ID:         containerJSON.ID[:12],
+		Name:       strings.TrimPrefix(containerJSON.Name, "/"),
+		Image:      containerJSON.Config.Image,
+		PID:        containerJSON.State.Pid,
+		State:      containerJSON.State.Status,
+		RootFS:     containerJSON.GraphDriver.Data["MergedDir"],
+		Runtime:    runtime,
+		BundlePath: fmt.Sprintf("/run/docker/runtime-%s/moby/%s", runtime, containerJSON.ID),
+		CgroupPath: containerJSON.HostConfig.CgroupParent,
+		Namespaces: make(map[string]string),
+		HostConfig: containerJSON.HostConfig,
+	}
+
+	populateNamespaces(info)
+
+	return info, nil
+}
+
+// containerdBackend talks to containerd directly, for Kubernetes nodes
+// where Docker isn't the runtime in front of containerd.
+type containerdBackend struct{}
+
+func (b *containerdBackend) Inspect(ctx context.Context, containerName string) (*ContainerInfo, error) {
+	client, err := containerd.New(containerdSocket)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to containerd: %w", err)
+	}
+	defer client.Close()
+
+	ctx = namespaces.WithNamespace(ctx, containerdNamespace)
+
+	ctr, err := client.LoadContainer(ctx, containerName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load container %s: %w", containerName, err)
+	}
+
+	task, err := ctr.Task(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load task for container %s: %w", containerName, err)
+	}
+
+	spec, err := ctr.Spec(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load OCI spec for container %s: %w", containerName, err)
+	}
+
+	info, err := ctr.Info(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load container info for %s: %w", containerName, err)
+	}
+
+	cgroupPath := ""
+	if spec.Linux != nil && spec.Linux.CgroupsPath != "" {
+		cgroupPath = spec.Linux.CgroupsPath
+	}
+
+	rootFS := ""
+	if spec.Root != nil {
+		rootFS = spec.Root.Path
+	}
+
+	result := &ContainerInfo{
+		ID:         ctr.ID(),
+		Name:       ctr.ID(),
+		Image:      info.Image,
+		PID:        int(task.Pid()),
+		State:      "running",
+		RootFS:     rootFS,
+		Runtime:    "containerd",
+		BundlePath: fmt.Sprintf("/run/containerd/io.containerd.runtime.v2.task/%s/%s", containerdNamespace, ctr.ID()),
+		CgroupPath: cgroupPath,
+		Namespaces: make(map[string]string),
+	}
+
+	populateNamespaces(result)
+
+	return result, nil
+}
+
+// crioBackend reads runc's on-disk state for containers managed by
+// CRI-O, which (unlike containerd) doesn't expose a client library this
+// tool depends on; state.json is the same format `crictl inspect` reads.
+type crioBackend struct{}
+
+// runcState is the subset of runc's state.json this tool needs.
+type runcState struct {
+	ID          string            `json:"id"`
+	Pid         int               `json:"pid"`
+	Bundle      string            `json:"bundle"`
+	Annotations map[string]string `json:"annotations"`
+}
+
+func (b *crioBackend) Inspect(ctx context.Context, containerName string) (*ContainerInfo, error) {
+	statePath := fmt.Sprintf("/run/runc/%s/state.json", containerName)
+
+	data, err := os.ReadFile(statePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read runc state for %s: %w", containerName, err)
+	}
+
+	var state runcState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("failed to parse runc state for %s: %w", containerName, err)
+	}
+
+	info := &ContainerInfo{
+		ID:         state.ID,
+		Name:       state.ID,
+		Image:      state.Annotations["io.kubernetes.cri-o.Image"],
+		PID:        state.Pid,
+		State:      "running",
+		RootFS:     fmt.Sprintf("%s/rootfs", state.Bundle),
+		Runtime:    "crio",
+		BundlePath: state.Bundle,
+		CgroupPath: state.Annotations["io.kubernetes.cri-o.CgroupParent"],
+		Namespaces: make(map[string]string),
+	}
+
+	populateNamespaces(info)
+
+	return info, nil
+}
+
+// populateNamespaces fills in the /proc/<pid>/ns/* paths shared by every
+// backend, once the pid has been resolved.
+func populateNamespaces(info *ContainerInfo) {
+	nsTypes := []string{"ipc", "mnt", "net", "pid", "user", "uts", "cgroup"}
+	for _, ns := range nsTypes {
+		info.Namespaces[ns] = fmt.Sprintf("/proc/%d/ns/%s", info.PID, ns)
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"syscall"
+
+	"github.com/checkpoint-restore/go-criu/v7/rpc"
+	"google.golang.org/protobuf/proto"
+)
+
+// cgroup2SuperMagic is the f_type value statfs(2) reports for the
+// cgroup v2 unified hierarchy (see linux/magic.h CGROUP2_SUPER_MAGIC).
+const cgroup2SuperMagic = 0x63677270
+
+// isCgroupV2 reports whether the host is running the cgroup v2 unified
+// hierarchy, detected by statfs'ing /sys/fs/cgroup for cgroup2fs.
+func isCgroupV2() bool {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs("/sys/fs/cgroup", &stat); err != nil {
+		return false
+	}
+	return int64(stat.Type) == cgroup2SuperMagic
+}
+
+// unifiedCgroupPath reads /proc/<pid>/cgroup and returns the process's
+// path within the cgroup v2 unified hierarchy, where entries look like
+// "0::/docker/<id>" rather than the per-controller "4:memory:/..." lines
+// used on v1.
+func unifiedCgroupPath(pid int) (string, error) {
+	cgroupFile := fmt.Sprintf("/proc/%d/cgroup", pid)
+
+	file, err := os.Open(cgroupFile)
+	if err != nil {
+		return "", fmt.Errorf("failed to open %s: %w", cgroupFile, err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := scanner.Text()
+		fields := strings.SplitN(line, ":", 3)
+		if len(fields) == 3 && fields[0] == "0" && fields[1] == "" {
+			return fields[2], nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", cgroupFile, err)
+	}
+
+	return "", fmt.Errorf("no unified cgroup entry found in %s", cgroupFile)
+}
+
+// cgroupRoots builds the CgRoot list CRIU needs to checkpoint or restore
+// a container's cgroup membership, handling both the legacy
+// per-controller v1 hierarchy and the v2 unified hierarchy. Both
+// doCRIUCheckpoint and doCRIURestore call this so a checkpoint taken on
+// a cgroup v2 host restores correctly with the same unified CgRoot. It
+// also returns the cgroup path it resolved, so callers can persist it
+// (e.g. doCRIUCheckpoint saves it to container.json, since the pid used
+// to resolve a v2 unified path no longer exists by restore time).
+func cgroupRoots(cgroupPath, id string, pid int) ([]*rpc.CgroupRoot, string, error) {
+	if isCgroupV2() {
+		if cgroupPath == "" {
+			unified, err := unifiedCgroupPath(pid)
+			if err != nil {
+				return nil, "", err
+			}
+			cgroupPath = unified
+		}
+
+		return []*rpc.CgroupRoot{
+			{
+				Ctrl: proto.String(""),
+				Path: proto.String(cgroupPath),
+			},
+		}, cgroupPath, nil
+	}
+
+	if cgroupPath == "" {
+		cgroupPath = fmt.Sprintf("/docker/%s", id)
+	}
+
+	return []*rpc.CgroupRoot{
+		{
+			Ctrl: proto.String("cpu"),
+			Path: proto.String(cgroupPath),
+		},
+		{
+			Ctrl: proto.String("memory"),
+			Path: proto.String(cgroupPath),
+		},
+	}, cgroupPath, nil
+}
+
+// cgroupManageMode maps the -cgroup-mode flag to CRIU's manage_cgroups_mode,
+// defaulting to SOFT on cgroup v2 (where the unified hierarchy makes a
+// strict controller-by-controller restore impractical) and FULL on v1. It
+// also returns the resolved mode name ("soft", "full", "strict" or
+// "ignore"), so a caller that auto-detected (mode == "") can persist the
+// decision it actually made rather than the empty flag value, letting
+// restore reuse the same mode instead of re-auto-detecting against
+// whatever cgroup hierarchy happens to be mounted on the restore host.
+func cgroupManageMode(mode string) (rpc.CriuCgMode, string, error) {
+	if mode == "" {
+		if isCgroupV2() {
+			return rpc.CriuCgMode_SOFT, "soft", nil
+		}
+		return rpc.CriuCgMode_FULL, "full", nil
+	}
+
+	switch mode {
+	case "soft":
+		return rpc.CriuCgMode_SOFT, mode, nil
+	case "full":
+		return rpc.CriuCgMode_FULL, mode, nil
+	case "strict":
+		return rpc.CriuCgMode_STRICT, mode, nil
+	case "ignore":
+		return rpc.CriuCgMode_IGNORE, mode, nil
+	default:
+		return 0, "", fmt.Errorf("unknown -cgroup-mode %q (want soft, full, strict or ignore)", mode)
+	}
+}
@@ -8,11 +8,10 @@ import (
 	"log"
 	"os"
 	"path/filepath"
-	"strings"
 
 	"github.com/checkpoint-restore/go-criu/v7"
 	"github.com/checkpoint-restore/go-criu/v7/rpc"
-	"github.com/docker/docker/client"
+	"github.com/docker/docker/api/types/container"
 	"google.golang.org/protobuf/proto"
 )
 
@@ -20,6 +19,7 @@ import (
 type ContainerInfo struct {
 	ID         string
 	Name       string
+	Image      string
 	PID        int
 	State      string
 	RootFS     string
@@ -27,6 +27,10 @@ type ContainerInfo struct {
 	BundlePath string
 	Namespaces map[string]string
 	CgroupPath string
+	// HostConfig is only populated by the Docker backend; restore uses it
+	// to recreate a container shell with the same mounts and volumes if
+	// Docker no longer knows about the container.
+	HostConfig *container.HostConfig
 }
 
 // Options for checkpoint operation
@@ -35,6 +39,31 @@ type Options struct {
 	TCPEstablished bool
 	FileLocks      bool
 	PreDump        bool
+	PreDumpIters   int
+	CgroupMode     string
+}
+
+// CheckpointMetadata is the container.json document saved alongside a
+// checkpoint's CRIU images, and read back again on restore.
+type CheckpointMetadata struct {
+	ID             string            `json:"id"`
+	Name           string            `json:"name"`
+	Image          string            `json:"image"`
+	Runtime        string            `json:"runtime"`
+	RootFS         string            `json:"rootfs"`
+	BundlePath     string            `json:"bundle_path"`
+	Namespaces     map[string]string `json:"namespaces"`
+	CgroupPath     string            `json:"cgroup_path"`
+	CgroupMode     string            `json:"cgroup_mode"`
+	TCPEstablished bool              `json:"tcp_established"`
+	FileLocks      bool              `json:"file_locks"`
+	LeaveRunning   bool              `json:"leave_running"`
+	PreDump        bool              `json:"pre_dump"`
+	PreCheckpoints []string          `json:"pre_checkpoints,omitempty"`
+	// HostConfig is the Docker host config captured at checkpoint time, so
+	// restore can recreate a container shell with the same mounts and
+	// volumes if Docker no longer knows about the container.
+	HostConfig *container.HostConfig `json:"host_config,omitempty"`
 }
 
 func main() {
@@ -46,6 +75,13 @@ func main() {
 		tcpEstablished bool
 		fileLocks      bool
 		preDump        bool
+		preDumpIters   int
+		restore        bool
+		printStats     bool
+		exportPath     string
+		importPath     string
+		cgroupMode     string
+		runtimeFlag    string
 	)
 
 	flag.StringVar(&containerName, "container", "", "Container name or ID to checkpoint")
@@ -55,6 +91,13 @@ func main() {
 	flag.BoolVar(&tcpEstablished, "tcp", true, "Checkpoint established TCP connections")
 	flag.BoolVar(&fileLocks, "file-locks", true, "Checkpoint file locks")
 	flag.BoolVar(&preDump, "pre-dump", false, "Perform pre-dump for optimization")
+	flag.IntVar(&preDumpIters, "pre-dump-iters", 1, "Number of chained pre-dump iterations to run before the final dump (requires -pre-dump)")
+	flag.BoolVar(&restore, "restore", false, "Restore the container from the named checkpoint instead of checkpointing it")
+	flag.BoolVar(&printStats, "print-stats", false, "Print checkpoint statistics decoded from CRIU's stats-dump image")
+	flag.StringVar(&exportPath, "export", "", "Export the checkpoint as a portable archive at this path after checkpointing")
+	flag.StringVar(&importPath, "import", "", "Import a portable checkpoint archive into -dir instead of checkpointing")
+	flag.StringVar(&cgroupMode, "cgroup-mode", "", "CRIU cgroup manage mode: soft, full, strict or ignore (default: soft on cgroup v2, full on v1)")
+	flag.StringVar(&runtimeFlag, "runtime", "", "Container runtime backend: docker, containerd or crio (default: auto-detect)")
 
 	flag.Parse()
 
@@ -69,10 +112,29 @@ func main() {
 		TCPEstablished: tcpEstablished,
 		FileLocks:      fileLocks,
 		PreDump:        preDump,
+		PreDumpIters:   preDumpIters,
+		CgroupMode:     cgroupMode,
+	}
+
+	if importPath != "" {
+		fmt.Printf("Importing checkpoint archive '%s'...\n", importPath)
+		if err := importCheckpointArchive(importPath, baseDir, containerName, checkpointName); err != nil {
+			log.Fatal("Import failed:", err)
+		}
+		return
+	}
+
+	if restore {
+		fmt.Printf("Starting restore of container '%s' from checkpoint '%s'...\n", containerName, checkpointName)
+		if err := restoreContainer(containerName, checkpointName, baseDir, printStats); err != nil {
+			log.Fatal("Restore failed:", err)
+		}
+		fmt.Printf("\nRestore successful!\n")
+		return
 	}
 
 	fmt.Printf("Starting checkpoint of container '%s'...\n", containerName)
-	if err := checkpointContainer(containerName, checkpointName, baseDir, opts); err != nil {
+	if err := checkpointContainer(containerName, checkpointName, baseDir, opts, printStats, exportPath, runtimeFlag); err != nil {
 		log.Fatal("Checkpoint failed:", err)
 	}
 
@@ -87,9 +149,9 @@ func main() {
 	}
 }
 
-func checkpointContainer(containerName, checkpointName, baseDir string, opts Options) error {
+func checkpointContainer(containerName, checkpointName, baseDir string, opts Options, printStats bool, exportPath, runtimeFlag string) error {
 	// Get container information
-	info, err := inspectContainer(containerName)
+	info, err := inspectContainer(containerName, runtimeFlag)
 	if err != nil {
 		return fmt.Errorf("failed to inspect container: %w", err)
 	}
@@ -106,80 +168,72 @@ func checkpointContainer(containerName, checkpointName, baseDir string, opts Opt
 	fmt.Printf("\nCheckpointing to: %s\n", checkpointDir)
 
 	// Perform the checkpoint
-	if err := doCRIUCheckpoint(info, checkpointDir, opts); err != nil {
+	preCheckpoints, err := doCRIUCheckpoint(info, checkpointDir, &opts)
+	if err != nil {
 		return fmt.Errorf("checkpoint failed: %w", err)
 	}
 
 	// Save metadata
-	if err := saveMetadata(info, checkpointDir); err != nil {
+	if err := saveMetadata(info, checkpointDir, opts, preCheckpoints); err != nil {
 		return fmt.Errorf("failed to save metadata: %w", err)
 	}
 
-	fmt.Printf("Checkpoint successful!\n")
-	return nil
-}
-
-func inspectContainer(containerName string) (*ContainerInfo, error) {
-	ctx := context.Background()
-
-	cli, err := client.NewClientWithOpts(client.FromEnv)
+	checkpointStats, err := readDumpStatistics(checkpointDir)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create docker client: %w", err)
+		return fmt.Errorf("failed to read checkpoint statistics: %w", err)
 	}
-
-	containerJSON, err := cli.ContainerInspect(ctx, containerName)
-	if err != nil {
-		return nil, fmt.Errorf("failed to inspect container: %w", err)
+	if err := saveStatistics(checkpointDir, checkpointStats); err != nil {
+		return fmt.Errorf("failed to save checkpoint statistics: %w", err)
 	}
-
-	if !containerJSON.State.Running {
-		return nil, fmt.Errorf("container %s is not running", containerName)
+	if printStats {
+		printStatistics("Checkpoint", checkpointStats)
 	}
 
-	runtime := containerJSON.HostConfig.Runtime
-	if runtime == "" {
-		runtime = "runc"
+	if exportPath != "" {
+		if err := exportCheckpointArchive(info, checkpointDir, exportPath); err != nil {
+			return fmt.Errorf("failed to export checkpoint archive: %w", err)
+		}
 	}
 
-	info := &ContainerInfo{
-		ID:         containerJSON.ID[:12],
-		Name:       strings.TrimPrefix(containerJSON.Name, "/"),
-		PID:        containerJSON.State.Pid,
-		State:      containerJSON.State.Status,
-		RootFS:     containerJSON.GraphDriver.Data["MergedDir"],
-		Runtime:    runtime,
-		BundlePath: fmt.Sprintf("/run/docker/runtime-%s/moby/%s", runtime, containerJSON.ID),
-		CgroupPath: containerJSON.HostConfig.CgroupParent,
-		Namespaces: make(map[string]string),
-	}
+	fmt.Printf("Checkpoint successful!\n")
+	return nil
+}
 
-	// Get namespace information
-	nsTypes := []string{"ipc", "mnt", "net", "pid", "user", "uts", "cgroup"}
-	for _, ns := range nsTypes {
-		info.Namespaces[ns] = fmt.Sprintf("/proc/%d/ns/%s", info.PID, ns)
+func inspectContainer(containerName, runtimeFlag string) (*ContainerInfo, error) {
+	backend, err := selectBackend(runtimeFlag)
+	if err != nil {
+		return nil, fmt.Errorf("failed to select container backend: %w", err)
 	}
 
-	return info, nil
+	return backend.Inspect(context.Background(), containerName)
 }
 
-func doCRIUCheckpoint(info *ContainerInfo, checkpointDir string, opts Options) error {
+func doCRIUCheckpoint(info *ContainerInfo, checkpointDir string, opts *Options) ([]string, error) {
 	criuClient := criu.MakeCriu()
 	criuClient.SetCriuPath("criu")
 
-	cgroupPath := info.CgroupPath
-	if cgroupPath == "" {
-		cgroupPath = fmt.Sprintf("/docker/%s", info.ID)
+	cgRoots, resolvedCgroupPath, err := cgroupRoots(info.CgroupPath, info.ID, info.PID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve cgroup roots: %w", err)
+	}
+	info.CgroupPath = resolvedCgroupPath
+
+	cgMode, resolvedCgroupMode, err := cgroupManageMode(opts.CgroupMode)
+	if err != nil {
+		return nil, err
 	}
+	opts.CgroupMode = resolvedCgroupMode
 
 	criuOpts := &rpc.CriuOpts{
-		Pid:            proto.Int32(int32(info.PID)),
-		LogLevel:       proto.Int32(4),
-		LogFile:        proto.String("dump.log"),
-		Root:           proto.String(info.RootFS),
-		ManageCgroups:  proto.Bool(true),
-		TcpEstablished: proto.Bool(opts.TCPEstablished),
-		FileLocks:      proto.Bool(opts.FileLocks),
-		LeaveRunning:   proto.Bool(opts.LeaveRunning),
+		Pid:               proto.Int32(int32(info.PID)),
+		LogLevel:          proto.Int32(4),
+		LogFile:           proto.String("dump.log"),
+		Root:              proto.String(info.RootFS),
+		ManageCgroups:     proto.Bool(true),
+		ManageCgroupsMode: &cgMode,
+		TcpEstablished:    proto.Bool(opts.TCPEstablished),
+		FileLocks:         proto.Bool(opts.FileLocks),
+		LeaveRunning:      proto.Bool(opts.LeaveRunning),
 		External: []string{
 			"mnt[/proc]:proc",
 			"mnt[/dev]:dev",
@@ -193,35 +247,28 @@ func doCRIUCheckpoint(info *ContainerInfo, checkpointDir string, opts Options) e
 			"mnt[/sys/fs/cgroup]:cgroup",
 		},
 		ShellJob: proto.Bool(true),
-		CgRoot: []*rpc.CgroupRoot{
-			{
-				Ctrl: proto.String("cpu"),
-				Path: proto.String(cgroupPath),
-			},
-			{
-				Ctrl: proto.String("memory"),
-				Path: proto.String(cgroupPath),
-			},
-		},
+		CgRoot:   cgRoots,
 	}
 
 	workDir, err := os.Open(checkpointDir)
 	if err != nil {
-		return fmt.Errorf("failed to open checkpoint directory: %w", err)
+		return nil, fmt.Errorf("failed to open checkpoint directory: %w", err)
 	}
 	defer workDir.Close()
 
 	// Set images directory using file descriptor
 	criuOpts.ImagesDirFd = proto.Int32(int32(workDir.Fd()))
 
+	var preCheckpoints []string
+
 	if opts.PreDump {
-		fmt.Println("Performing pre-dump...")
-		preDumpOpts := *criuOpts
-		preDumpOpts.TrackMem = proto.Bool(true)
-		preDumpOpts.TcpEstablished = proto.Bool(false)
+		preCheckpoints, err = doPreDumps(criuClient, criuOpts, checkpointDir, opts.PreDumpIters)
+		if err != nil {
+			return nil, err
+		}
 
-		if err := criuClient.PreDump(&preDumpOpts, nil); err != nil {
-			return fmt.Errorf("pre-dump failed: %w", err)
+		if last := len(preCheckpoints) - 1; last >= 0 {
+			criuOpts.ParentImg = proto.String(preCheckpoints[last])
 		}
 	}
 
@@ -232,23 +279,88 @@ func doCRIUCheckpoint(info *ContainerInfo, checkpointDir string, opts Options) e
 		if logData, readErr := os.ReadFile(logPath); readErr == nil {
 			fmt.Printf("CRIU log:\n%s\n", logData)
 		}
-		return fmt.Errorf("CRIU dump failed: %w", err)
+		return nil, fmt.Errorf("CRIU dump failed: %w", err)
 	}
 
-	return nil
+	return preCheckpoints, nil
 }
 
-func saveMetadata(info *ContainerInfo, checkpointDir string) error {
+// doPreDumps runs a chain of iterative pre-dumps under checkpointDir,
+// each one tracking only the pages dirtied since the previous iteration.
+// Iteration i's images live in "pre-<i>" (relative to checkpointDir) and
+// carry a ParentImg of "../pre-<i-1>", the previous iteration's directory
+// relative to this iteration's own images directory, so CRIU can resolve
+// the chain.
+// It returns the relative directory names of the iterations it performed,
+// in order, so the final dump (and container.json) can reference them.
+func doPreDumps(criuClient *criu.Criu, baseOpts *rpc.CriuOpts, checkpointDir string, iters int) ([]string, error) {
+	preCheckpoints := make([]string, 0, iters)
+
+	for i := 0; i < iters; i++ {
+		relDir := fmt.Sprintf("pre-%d", i)
+		absDir := filepath.Join(checkpointDir, relDir)
+
+		if err := os.MkdirAll(absDir, 0755); err != nil {
+			return nil, fmt.Errorf("failed to create pre-dump directory %s: %w", relDir, err)
+		}
+
+		preDumpDir, err := os.Open(absDir)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open pre-dump directory %s: %w", relDir, err)
+		}
+
+		preDumpOpts := &rpc.CriuOpts{
+			Pid:               baseOpts.Pid,
+			LogLevel:          baseOpts.LogLevel,
+			LogFile:           baseOpts.LogFile,
+			Root:              baseOpts.Root,
+			ManageCgroups:     baseOpts.ManageCgroups,
+			ManageCgroupsMode: baseOpts.ManageCgroupsMode,
+			FileLocks:         baseOpts.FileLocks,
+			LeaveRunning:      baseOpts.LeaveRunning,
+			External:          baseOpts.External,
+			ShellJob:          baseOpts.ShellJob,
+			CgRoot:            baseOpts.CgRoot,
+			ImagesDirFd:       proto.Int32(int32(preDumpDir.Fd())),
+			TrackMem:          proto.Bool(true),
+			TcpEstablished:    proto.Bool(false),
+		}
+		if len(preCheckpoints) > 0 {
+			preDumpOpts.ParentImg = proto.String(filepath.Join("..", preCheckpoints[len(preCheckpoints)-1]))
+		}
+
+		fmt.Printf("Performing pre-dump iteration %d/%d...\n", i+1, iters)
+		err = criuClient.PreDump(preDumpOpts, nil)
+		preDumpDir.Close()
+		if err != nil {
+			return nil, fmt.Errorf("pre-dump iteration %d failed: %w", i, err)
+		}
+
+		preCheckpoints = append(preCheckpoints, relDir)
+	}
+
+	return preCheckpoints, nil
+}
+
+func saveMetadata(info *ContainerInfo, checkpointDir string, opts Options, preCheckpoints []string) error {
 	metadataFile := filepath.Join(checkpointDir, "container.json")
 
-	metadata := map[string]interface{}{
-		"id":          info.ID,
-		"name":        info.Name,
-		"runtime":     info.Runtime,
-		"rootfs":      info.RootFS,
-		"bundle_path": info.BundlePath,
-		"namespaces":  info.Namespaces,
-		"cgroup_path": info.CgroupPath,
+	metadata := CheckpointMetadata{
+		ID:             info.ID,
+		Name:           info.Name,
+		Image:          info.Image,
+		Runtime:        info.Runtime,
+		RootFS:         info.RootFS,
+		BundlePath:     info.BundlePath,
+		Namespaces:     info.Namespaces,
+		CgroupPath:     info.CgroupPath,
+		CgroupMode:     opts.CgroupMode,
+		TCPEstablished: opts.TCPEstablished,
+		FileLocks:      opts.FileLocks,
+		LeaveRunning:   opts.LeaveRunning,
+		PreDump:        opts.PreDump,
+		PreCheckpoints: preCheckpoints,
+		HostConfig:     info.HostConfig,
 	}
 
 	file, err := os.Create(metadataFile)
@@ -262,6 +374,24 @@ func saveMetadata(info *ContainerInfo, checkpointDir string) error {
 	return encoder.Encode(metadata)
 }
 
+// loadMetadata reads back the container.json document written by
+// saveMetadata for a given checkpoint.
+func loadMetadata(checkpointDir string) (*CheckpointMetadata, error) {
+	metadataFile := filepath.Join(checkpointDir, "container.json")
+
+	data, err := os.ReadFile(metadataFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read checkpoint metadata: %w", err)
+	}
+
+	var metadata CheckpointMetadata
+	if err := json.Unmarshal(data, &metadata); err != nil {
+		return nil, fmt.Errorf("failed to parse checkpoint metadata: %w", err)
+	}
+
+	return &metadata, nil
+}
+
 func printContainerInfo(info *ContainerInfo) {
 	fmt.Printf("Container Information:\n")
 	fmt.Printf("  ID:         %s\n", info.ID)
@@ -276,4 +406,4 @@ func printContainerInfo(info *ContainerInfo) {
 	for ns, path := range info.Namespaces {
 		fmt.Printf("    %s: %s\n", ns, path)
 	}
-}
\ No newline at end of file
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/checkpoint-restore/go-criu/v7"
+	"github.com/checkpoint-restore/go-criu/v7/rpc"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/volume"
+	"github.com/docker/docker/client"
+	dockerarchive "github.com/docker/docker/pkg/archive"
+	"google.golang.org/protobuf/proto"
+)
+
+// restoreContainer reconstructs a container from a previously taken
+// checkpoint and hands it off to CRIU to resume execution.
+func restoreContainer(containerName, checkpointName, baseDir string, printStats bool) error {
+	checkpointDir := filepath.Join(baseDir, containerName, checkpointName)
+
+	metadata, err := loadMetadata(checkpointDir)
+	if err != nil {
+		return fmt.Errorf("failed to load checkpoint metadata: %w", err)
+	}
+
+	if metadata.Runtime != "" && metadata.Runtime != "docker" {
+		return fmt.Errorf("-restore only supports checkpoints taken against the docker runtime backend, this one was taken via %q", metadata.Runtime)
+	}
+
+	ctx := context.Background()
+	cli, err := client.NewClientWithOpts(client.FromEnv)
+	if err != nil {
+		return fmt.Errorf("failed to create docker client: %w", err)
+	}
+
+	rootFS, shellPID, err := ensureContainerShell(ctx, cli, containerName, metadata)
+	if err != nil {
+		return fmt.Errorf("failed to prepare container shell: %w", err)
+	}
+
+	if err := applyRootFSDiff(checkpointDir, rootFS); err != nil {
+		return fmt.Errorf("failed to apply rootfs diff: %w", err)
+	}
+
+	if err := applyVolumes(ctx, cli, checkpointDir); err != nil {
+		return fmt.Errorf("failed to restore volumes: %w", err)
+	}
+
+	fmt.Printf("\nRestoring to: %s\n", checkpointDir)
+
+	if err := doCRIURestore(metadata, rootFS, shellPID, checkpointDir); err != nil {
+		return fmt.Errorf("restore failed: %w", err)
+	}
+
+	restoreStats, err := readRestoreStatistics(checkpointDir)
+	if err != nil {
+		return fmt.Errorf("failed to read restore statistics: %w", err)
+	}
+	if err := saveRestoreStatistics(checkpointDir, restoreStats); err != nil {
+		return fmt.Errorf("failed to save restore statistics: %w", err)
+	}
+	if printStats {
+		printRestoreStatistics("Restore", restoreStats)
+	}
+
+	return nil
+}
+
+// shellPlaceholderEntrypoint overrides the image's own command when
+// re-creating a container shell, so the shell's process just idles
+// instead of running the real workload. Without this, Docker would start
+// the checkpointed application itself (e.g. binding the same port the
+// restored process is about to bind), racing CRIU restore in the very
+// namespaces ensureContainerShell exists to hand it.
+var shellPlaceholderEntrypoint = []string{"sleep", "infinity"}
+
+// ensureContainerShell makes sure a container exists for containerName,
+// re-creating it from the checkpointed image and its original host config
+// (mounts, volumes, network mode, ...) if Docker no longer knows about it,
+// and returns the rootfs CRIU should restore into along with the shell's
+// live pid. The shell is started (but not the workload itself, which CRIU
+// restore takes over) so its namespaces exist for doCRIURestore to join.
+func ensureContainerShell(ctx context.Context, cli *client.Client, containerName string, metadata *CheckpointMetadata) (string, int, error) {
+	containerJSON, err := cli.ContainerInspect(ctx, containerName)
+	if err == nil {
+		if !containerJSON.State.Running {
+			return "", 0, fmt.Errorf("container %s exists but isn't running, and can't be started as a placeholder shell without replacing its original command; remove it first so it can be re-created", containerName)
+		}
+		return containerJSON.GraphDriver.Data["MergedDir"], containerJSON.State.Pid, nil
+	}
+	if !client.IsErrNotFound(err) {
+		return "", 0, fmt.Errorf("failed to inspect container: %w", err)
+	}
+
+	fmt.Printf("Container '%s' not found, re-creating shell from image '%s'...\n", containerName, metadata.Image)
+
+	created, err := cli.ContainerCreate(ctx, &container.Config{
+		Image:      metadata.Image,
+		Entrypoint: shellPlaceholderEntrypoint,
+		Cmd:        nil,
+	}, metadata.HostConfig, nil, nil, containerName)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to re-create container: %w", err)
+	}
+
+	if err := cli.ContainerStart(ctx, created.ID, container.StartOptions{}); err != nil {
+		return "", 0, fmt.Errorf("failed to start re-created container shell: %w", err)
+	}
+
+	containerJSON, err = cli.ContainerInspect(ctx, created.ID)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to inspect re-created container: %w", err)
+	}
+
+	return containerJSON.GraphDriver.Data["MergedDir"], containerJSON.State.Pid, nil
+}
+
+// applyRootFSDiff lays the files an -export archive captured from the
+// container's r/w layer back onto rootFS, if the checkpoint was imported
+// from one. It is a no-op for checkpoints that were never exported.
+func applyRootFSDiff(checkpointDir, rootFS string) error {
+	diffPath := filepath.Join(checkpointDir, "rootfs-diff.tar")
+
+	diffFile, err := os.Open(diffPath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", diffPath, err)
+	}
+	defer diffFile.Close()
+
+	fmt.Printf("Applying rootfs diff onto %s...\n", rootFS)
+	return dockerarchive.Untar(diffFile, rootFS, &dockerarchive.TarOptions{NoLchown: true})
+}
+
+// applyVolumes restores the named-volume tarballs an -export archive
+// captured, creating each volume if it doesn't already exist. It is a
+// no-op for checkpoints that were never exported or that mounted no
+// named volumes.
+func applyVolumes(ctx context.Context, cli *client.Client, checkpointDir string) error {
+	volumesDir := filepath.Join(checkpointDir, "volumes")
+
+	entries, err := os.ReadDir(volumesDir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", volumesDir, err)
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".tar" {
+			continue
+		}
+		volumeName := strings.TrimSuffix(entry.Name(), ".tar")
+
+		vol, err := cli.VolumeInspect(ctx, volumeName)
+		if err != nil {
+			vol, err = cli.VolumeCreate(ctx, volume.CreateOptions{Name: volumeName})
+			if err != nil {
+				return fmt.Errorf("failed to create volume %s: %w", volumeName, err)
+			}
+		}
+
+		volumeTar, err := os.Open(filepath.Join(volumesDir, entry.Name()))
+		if err != nil {
+			return fmt.Errorf("failed to open volume archive for %s: %w", volumeName, err)
+		}
+
+		fmt.Printf("Restoring volume '%s' into %s...\n", volumeName, vol.Mountpoint)
+		err = dockerarchive.Untar(volumeTar, vol.Mountpoint, &dockerarchive.TarOptions{NoLchown: true})
+		volumeTar.Close()
+		if err != nil {
+			return fmt.Errorf("failed to restore volume %s: %w", volumeName, err)
+		}
+	}
+
+	return nil
+}
+
+// doCRIURestore invokes CRIU's restore against the images previously
+// written by doCRIUCheckpoint, mirroring the options used at dump time.
+func doCRIURestore(metadata *CheckpointMetadata, rootFS string, shellPID int, checkpointDir string) error {
+	criuClient := criu.MakeCriu()
+	criuClient.SetCriuPath("criu")
+
+	// The pid this container had at checkpoint time is gone by restore
+	// time, so pid 0 is passed: on a v2 host with no cgroup path in
+	// metadata, cgroupRoots then fails to read /proc/0/cgroup and returns
+	// an error (shouldn't normally happen, since doCRIUCheckpoint persists
+	// the path it resolved).
+	cgRoots, _, err := cgroupRoots(metadata.CgroupPath, metadata.ID, 0)
+	if err != nil {
+		return fmt.Errorf("failed to resolve cgroup roots: %w", err)
+	}
+
+	cgMode, _, err := cgroupManageMode(metadata.CgroupMode)
+	if err != nil {
+		return err
+	}
+
+	criuOpts := &rpc.CriuOpts{
+		LogLevel:          proto.Int32(4),
+		LogFile:           proto.String("restore.log"),
+		Root:              proto.String(rootFS),
+		RstSibling:        proto.Bool(false),
+		ManageCgroups:     proto.Bool(true),
+		ManageCgroupsMode: &cgMode,
+		TcpEstablished:    proto.Bool(metadata.TCPEstablished),
+		FileLocks:         proto.Bool(metadata.FileLocks),
+		ShellJob:          proto.Bool(true),
+		External: []string{
+			"mnt[/proc]:proc",
+			"mnt[/dev]:dev",
+			"mnt[/sys]:sys",
+			"mnt[/dev/shm]:shm",
+			"mnt[/dev/pts]:pts",
+			"mnt[/dev/mqueue]:mqueue",
+			"mnt[/etc/hostname]:hostname",
+			"mnt[/etc/hosts]:hosts",
+			"mnt[/etc/resolv.conf]:resolv.conf",
+			"mnt[/sys/fs/cgroup]:cgroup",
+		},
+		CgRoot: cgRoots,
+		JoinNs: joinNamespaces(shellPID),
+	}
+
+	imagesDir, err := os.Open(checkpointDir)
+	if err != nil {
+		return fmt.Errorf("failed to open checkpoint directory: %w", err)
+	}
+	defer imagesDir.Close()
+
+	criuOpts.ImagesDirFd = proto.Int32(int32(imagesDir.Fd()))
+
+	fmt.Println("Performing restore...")
+
+	if err := criuClient.Restore(criuOpts, nil); err != nil {
+		logPath := filepath.Join(checkpointDir, "restore.log")
+		if logData, readErr := os.ReadFile(logPath); readErr == nil {
+			fmt.Printf("CRIU log:\n%s\n", logData)
+		}
+		return fmt.Errorf("CRIU restore failed: %w", err)
+	}
+
+	return nil
+}
+
+// joinNamespaces builds the JoinNs list that lets CRIU restore the
+// checkpointed process into the net and ipc namespaces already set up by
+// the live container shell, instead of the namespaces recorded in
+// metadata.Namespaces (which point at a pid that's gone by restore time).
+// mnt, pid and uts are deliberately left out: CRIU creates those fresh
+// from the dump itself, and joining the shell's own pid namespace would
+// collide with the init process it is already running.
+func joinNamespaces(shellPID int) []*rpc.JoinNamespace {
+	nsTypes := []string{"net", "ipc"}
+
+	joins := make([]*rpc.JoinNamespace, 0, len(nsTypes))
+	for _, ns := range nsTypes {
+		joins = append(joins, &rpc.JoinNamespace{
+			Ns:     proto.String(ns),
+			NsFile: proto.String(fmt.Sprintf("/proc/%d/ns/%s", shellPID, ns)),
+		})
+	}
+
+	return joins
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/checkpoint-restore/go-criu/v7/stats"
+)
+
+// CheckpointStatistics summarizes the timing and memory counters CRIU
+// records for a dump, decoded from the stats-dump image it writes next
+// to the rest of the checkpoint.
+type CheckpointStatistics struct {
+	FrozenTime         uint32 `json:"frozen_time_us"`
+	FreezingTime       uint32 `json:"freezing_time_us"`
+	MemdumpTime        uint32 `json:"memdump_time_us"`
+	MemwriteTime       uint32 `json:"memwrite_time_us"`
+	PagesWritten       uint64 `json:"pages_written"`
+	PagesSkippedParent uint64 `json:"pages_skipped_parent"`
+}
+
+// readDumpStatistics decodes the stats-dump protobuf CRIU writes into
+// checkpointDir after a successful Dump.
+func readDumpStatistics(checkpointDir string) (*CheckpointStatistics, error) {
+	imagesDir, err := os.Open(checkpointDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open checkpoint directory: %w", err)
+	}
+	defer imagesDir.Close()
+
+	dumpStats, err := stats.CriuGetDumpStats(imagesDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read dump statistics: %w", err)
+	}
+
+	return &CheckpointStatistics{
+		FrozenTime:         dumpStats.GetFrozenTime(),
+		FreezingTime:       dumpStats.GetFreezingTime(),
+		MemdumpTime:        dumpStats.GetMemdumpTime(),
+		MemwriteTime:       dumpStats.GetMemwriteTime(),
+		PagesWritten:       dumpStats.GetPagesWritten(),
+		PagesSkippedParent: dumpStats.GetPagesSkippedParent(),
+	}, nil
+}
+
+// RestoreStatistics summarizes the timing and memory counters CRIU
+// records for a restore, decoded from the stats-restore image it writes
+// next to the rest of the checkpoint. It mirrors CheckpointStatistics but
+// has its own field set, since dump and restore track different things
+// (e.g. restore has no "frozen" phase, and instead reports how many
+// pages were served from the image vs. copy-on-write from the parent).
+type RestoreStatistics struct {
+	PagesCompared   uint64 `json:"pages_compared"`
+	PagesSkippedCow uint64 `json:"pages_skipped_cow"`
+	ForkingTime     uint32 `json:"forking_time_us"`
+	RestoreTime     uint32 `json:"restore_time_us"`
+	PagesRestored   uint64 `json:"pages_restored"`
+}
+
+// readRestoreStatistics decodes the stats-restore protobuf CRIU writes
+// into checkpointDir after a successful Restore.
+func readRestoreStatistics(checkpointDir string) (*RestoreStatistics, error) {
+	imagesDir, err := os.Open(checkpointDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open checkpoint directory: %w", err)
+	}
+	defer imagesDir.Close()
+
+	restoreStats, err := stats.CriuGetRestoreStats(imagesDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read restore statistics: %w", err)
+	}
+
+	return &RestoreStatistics{
+		PagesCompared:   restoreStats.GetPagesCompared(),
+		PagesSkippedCow: restoreStats.GetPagesSkippedCow(),
+		ForkingTime:     restoreStats.GetForkingTime(),
+		RestoreTime:     restoreStats.GetRestoreTime(),
+		PagesRestored:   restoreStats.GetPagesRestored(),
+	}, nil
+}
+
+// saveStatsJSON writes v to name inside checkpointDir, indented the same
+// way as the rest of this tool's on-disk JSON.
+func saveStatsJSON(checkpointDir, name string, v any) error {
+	file, err := os.Create(filepath.Join(checkpointDir, name))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	encoder := json.NewEncoder(file)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+// saveStatistics writes stats next to container.json so they can be
+// inspected later without re-parsing CRIU's protobuf image.
+func saveStatistics(checkpointDir string, s *CheckpointStatistics) error {
+	return saveStatsJSON(checkpointDir, "checkpoint-stats.json", s)
+}
+
+// printStatistics prints checkpoint counters in a human-readable form,
+// mirroring podman's `--print-stats` checkpoint output.
+func printStatistics(label string, s *CheckpointStatistics) {
+	fmt.Printf("\n%s statistics:\n", label)
+	fmt.Printf("  Frozen time:          %d us\n", s.FrozenTime)
+	fmt.Printf("  Freezing time:        %d us\n", s.FreezingTime)
+	fmt.Printf("  Memory dump time:     %d us\n", s.MemdumpTime)
+	fmt.Printf("  Memory write time:    %d us\n", s.MemwriteTime)
+	fmt.Printf("  Pages written:        %d\n", s.PagesWritten)
+	fmt.Printf("  Pages skipped parent: %d\n", s.PagesSkippedParent)
+}
+
+// saveRestoreStatistics writes restore stats next to container.json so
+// they can be inspected later without re-parsing CRIU's protobuf image.
+func saveRestoreStatistics(checkpointDir string, s *RestoreStatistics) error {
+	return saveStatsJSON(checkpointDir, "restore-stats.json", s)
+}
+
+// printRestoreStatistics prints restore counters in a human-readable
+// form, mirroring podman's `--print-stats` checkpoint output.
+func printRestoreStatistics(label string, s *RestoreStatistics) {
+	fmt.Printf("\n%s statistics:\n", label)
+	fmt.Printf("  Forking time:         %d us\n", s.ForkingTime)
+	fmt.Printf("  Restore time:         %d us\n", s.RestoreTime)
+	fmt.Printf("  Pages restored:       %d\n", s.PagesRestored)
+	fmt.Printf("  Pages compared:       %d\n", s.PagesCompared)
+	fmt.Printf("  Pages skipped (COW):  %d\n", s.PagesSkippedCow)
+}